@@ -27,6 +27,10 @@ func main() {
 	defer pool.Close()
 
 	db.SeedTestUser(pool)
+	// The dev admin has a well-known password; never seed it unless explicitly asked to.
+	if os.Getenv("SEED_DEV_ADMIN") == "true" {
+		db.SeedAdminUser(pool)
+	}
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
@@ -34,16 +38,30 @@ func main() {
 	}
 
 	h := handler.New(pool, jwtSecret)
+	go h.FlushDeprecatedUsagePeriodically()
 	auth := middleware.RequireAuth(jwtSecret)
+	admin := middleware.RequireAdmin(jwtSecret)
+	guestOrder := middleware.RequireGuestOrder(jwtSecret)
 
+	// Deprecated routes: wrap as auth(middleware.Deprecated(middleware.Deprecation{...}, h)(h.X)).
+	// Callers get Deprecation/Sunset headers and show up in GET /admin/deprecations.
+	// Deprecated response fields call middleware.MarkDeprecated from the handler (see GetOrder's user_id).
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /auth/login", h.Login)
+	mux.HandleFunc("POST /auth/claim", h.ClaimAccount)
 	mux.HandleFunc("GET /me", auth(h.Me))
 	mux.HandleFunc("GET /orders", auth(h.ListOrders))
 	mux.HandleFunc("POST /orders", auth(h.CreateOrder))
-	mux.HandleFunc("GET /orders/{id}", auth(h.GetOrder))
-	mux.HandleFunc("PUT /orders/{id}", auth(h.UpdateOrder))
-	mux.HandleFunc("GET /orders/{id}/summary", auth(h.OrderSummary))
+	mux.HandleFunc("POST /orders/guest", h.CreateGuestOrder)
+	mux.HandleFunc("GET /orders/{id}", guestOrder(h.GetOrder))
+	mux.HandleFunc("PUT /orders/{id}", guestOrder(h.UpdateOrder))
+	mux.HandleFunc("GET /orders/{id}/summary", guestOrder(h.OrderSummary))
+	mux.HandleFunc("GET /admin/webhooks", admin(h.ListWebhooks))
+	mux.HandleFunc("POST /admin/webhooks", admin(h.CreateWebhook))
+	mux.HandleFunc("POST /admin/webhooks/{id}/test", admin(h.TestWebhook))
+	mux.HandleFunc("POST /admin/orders/{id}/lock", admin(h.LockOrder))
+	mux.HandleFunc("DELETE /admin/orders/{id}/lock", admin(h.UnlockOrder))
+	mux.HandleFunc("GET /admin/deprecations", admin(h.DeprecationReport))
 
 	// CORS for frontend
 	cors := middleware.CORS(mux)
@@ -94,10 +94,28 @@ func SeedTestUser(db *sql.DB) {
 	}
 	_, err = db.Exec(
 		`INSERT INTO users (email, password_hash) VALUES ($1, $2)
-		 ON CONFLICT (email) DO UPDATE SET password_hash = EXCLUDED.password_hash`,
+		 ON CONFLICT (email) WHERE NOT is_guest DO UPDATE SET password_hash = EXCLUDED.password_hash`,
 		"user@weel.com", string(hash),
 	)
 	if err != nil {
 		log.Printf("seed: insert test user failed: %v", err)
 	}
 }
+
+// SeedAdminUser ensures admin@weel.com exists with password "password" and the admin flag set.
+// For tests and local development only: the server calls it only when SEED_DEV_ADMIN=true.
+func SeedAdminUser(db *sql.DB) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("seed: bcrypt failed: %v", err)
+		return
+	}
+	_, err = db.Exec(
+		`INSERT INTO users (email, password_hash, is_admin) VALUES ($1, $2, TRUE)
+		 ON CONFLICT (email) WHERE NOT is_guest DO UPDATE SET password_hash = EXCLUDED.password_hash, is_admin = TRUE`,
+		"admin@weel.com", string(hash),
+	)
+	if err != nil {
+		log.Printf("seed: insert admin user failed: %v", err)
+	}
+}
@@ -38,8 +38,9 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var id int
-	var hash string
-	err := h.db.QueryRow("SELECT id, password_hash FROM users WHERE email = $1", req.Email).Scan(&id, &hash)
+	var hash sql.NullString
+	var isAdmin bool
+	err := h.db.QueryRow("SELECT id, password_hash, is_admin FROM users WHERE email = $1 AND NOT is_guest", req.Email).Scan(&id, &hash, &isAdmin)
 	if err == sql.ErrNoRows {
 		http.Error(w, `{"error":"invalid credentials"}`, http.StatusUnauthorized)
 		return
@@ -49,18 +50,17 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)); err != nil {
+	// Unclaimed guest accounts have no password yet.
+	if !hash.Valid {
+		http.Error(w, `{"error":"invalid credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(req.Password)); err != nil {
 		http.Error(w, `{"error":"invalid credentials"}`, http.StatusUnauthorized)
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &middleware.Claims{
-		UserID: id,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-		},
-	})
-	signed, err := token.SignedString([]byte(h.jwt))
+	signed, err := h.signToken(&middleware.Claims{UserID: id, Admin: isAdmin}, 24*time.Hour)
 	if err != nil {
 		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
 		return
@@ -69,3 +69,9 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(LoginResponse{Token: signed})
 }
+
+// signToken fills in the expiry and signs c with the server's JWT secret.
+func (h *Handler) signToken(c *middleware.Claims, ttl time.Duration) (string, error) {
+	c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte(h.jwt))
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// deprecatedUsageFlushInterval is how often buffered deprecated-route counts are written to the DB.
+// Counts buffered since the last flush are lost if the process exits.
+const deprecatedUsageFlushInterval = time.Minute
+
+// deprecatedUsageMaxKeys caps the buffer, which grows by one entry per IP for anonymous callers and is
+// kept across failed flushes. Calls from new route/client pairs past the cap are dropped and counted.
+const deprecatedUsageMaxKeys = 10000
+
+type usageKey struct {
+	route, client string
+}
+
+type usageCount struct {
+	calls               int64
+	firstSeen, lastSeen time.Time
+}
+
+// usageBuffer accumulates deprecated-route calls in memory so the routes themselves never wait on the DB.
+type usageBuffer struct {
+	mu      sync.Mutex
+	counts  map[usageKey]usageCount
+	dropped int64
+}
+
+func newUsageBuffer() *usageBuffer {
+	return &usageBuffer{counts: make(map[usageKey]usageCount)}
+}
+
+func (b *usageBuffer) add(k usageKey, c usageCount) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur, ok := b.counts[k]
+	if !ok {
+		if len(b.counts) >= deprecatedUsageMaxKeys {
+			b.dropped += c.calls
+			return
+		}
+		b.counts[k] = c
+		return
+	}
+	cur.calls += c.calls
+	if c.firstSeen.Before(cur.firstSeen) {
+		cur.firstSeen = c.firstSeen
+	}
+	if c.lastSeen.After(cur.lastSeen) {
+		cur.lastSeen = c.lastSeen
+	}
+	b.counts[k] = cur
+}
+
+// take returns the buffered counts and the number of calls dropped since the last take, and starts a fresh buffer.
+func (b *usageBuffer) take() (map[usageKey]usageCount, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts, dropped := b.counts, b.dropped
+	b.counts = make(map[usageKey]usageCount)
+	b.dropped = 0
+	return counts, dropped
+}
+
+// DeprecatedUsage is one row of the admin report: a client still calling a deprecated route or field.
+type DeprecatedUsage struct {
+	Route     string    `json:"route"`
+	Client    string    `json:"client"`
+	Calls     int64     `json:"calls"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// RecordDeprecatedUsage implements middleware.UsageRecorder. It only bumps an in-memory counter;
+// FlushDeprecatedUsage logs and persists the counts off the request path.
+func (h *Handler) RecordDeprecatedUsage(route, client string) {
+	now := time.Now()
+	h.deprecated.add(usageKey{route: route, client: client}, usageCount{calls: 1, firstSeen: now, lastSeen: now})
+}
+
+// FlushDeprecatedUsage writes buffered counts to deprecated_route_usage. Counts that fail to write
+// are put back and retried on the next flush, subject to deprecatedUsageMaxKeys.
+func (h *Handler) FlushDeprecatedUsage() {
+	counts, dropped := h.deprecated.take()
+	if dropped > 0 {
+		log.Printf("deprecated: buffer full, %d calls were not recorded", dropped)
+	}
+	for k, c := range counts {
+		log.Printf("deprecated: %s called %d times by %s", k.route, c.calls, k.client)
+		_, err := h.db.Exec(
+			`INSERT INTO deprecated_route_usage (route, client, calls, first_seen, last_seen) VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (route, client) DO UPDATE SET calls = deprecated_route_usage.calls + EXCLUDED.calls,
+			 last_seen = GREATEST(deprecated_route_usage.last_seen, EXCLUDED.last_seen)`,
+			k.route, k.client, c.calls, c.firstSeen, c.lastSeen,
+		)
+		if err != nil {
+			log.Printf("deprecated: recording usage of %s by %s failed: %v", k.route, k.client, err)
+			h.deprecated.add(k, c)
+		}
+	}
+}
+
+// FlushDeprecatedUsagePeriodically runs FlushDeprecatedUsage every deprecatedUsageFlushInterval; run it in a goroutine.
+func (h *Handler) FlushDeprecatedUsagePeriodically() {
+	ticker := time.NewTicker(deprecatedUsageFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.FlushDeprecatedUsage()
+	}
+}
+
+// DeprecationReport lists who still calls deprecated routes, most recent first within each route.
+// This instance's buffered counts are flushed first; other instances' appear after their next flush.
+func (h *Handler) DeprecationReport(w http.ResponseWriter, r *http.Request) {
+	h.FlushDeprecatedUsage()
+
+	rows, err := h.db.Query(
+		"SELECT route, client, calls, first_seen, last_seen FROM deprecated_route_usage ORDER BY route, last_seen DESC",
+	)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var list []DeprecatedUsage
+	for rows.Next() {
+		var u DeprecatedUsage
+		if err := rows.Scan(&u.Route, &u.Client, &u.Calls, &u.FirstSeen, &u.LastSeen); err != nil {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		list = append(list, u)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []DeprecatedUsage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,379 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zeshan-weel/backend/internal/middleware"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// guestTokenTTL is how long a guest can use the token returned at checkout to view or edit their order.
+const guestTokenTTL = 7 * 24 * time.Hour
+
+// claimLinkTTL is how long the emailed magic link stays valid.
+const claimLinkTTL = 7 * 24 * time.Hour
+
+// minPasswordLength applies to passwords set when claiming a guest account.
+const minPasswordLength = 8
+
+type GuestOrderRequest struct {
+	Email string `json:"email"`
+	OrderRequest
+}
+
+// GuestOrder is the order as returned at guest checkout. It has no user_id: whether the guest user is
+// new or reused would otherwise be visible to anyone who can post an email address.
+type GuestOrder struct {
+	ID         int       `json:"id"`
+	Preference string    `json:"preference"`
+	Address    *string   `json:"address,omitempty"`
+	PickupTime *string   `json:"pickup_time,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// GuestOrderResponse returns the order plus a guest token scoped to that order only.
+type GuestOrderResponse struct {
+	Order GuestOrder `json:"order"`
+	Token string     `json:"token"`
+}
+
+type ClaimRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// CreateGuestOrder places an order without an account: it creates (or reuses) a provisional guest user,
+// emails a magic link for claiming the account later, and returns a guest token limited to the new order.
+// Full accounts are never written to: if the email belongs to one, the order still goes on a guest user
+// and the owner is emailed a notice instead of a claim link. The response is the same either way, so the
+// endpoint cannot be used to probe which emails have accounts. Requests are throttled per client IP and per email.
+func (h *Handler) CreateGuestOrder(w http.ResponseWriter, r *http.Request) {
+	if !h.guestIPLimit.allow(middleware.ClientID(r)) {
+		http.Error(w, `{"error":"too many requests, please try again later"}`, http.StatusTooManyRequests)
+		return
+	}
+
+	var req GuestOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || addr.Name != "" {
+		http.Error(w, `{"error":"valid email required"}`, http.StatusBadRequest)
+		return
+	}
+	// Guest users are stored and looked up by the lowercased address so "User@weel.com" and
+	// "user@weel.com" share one guest user and one rate limit.
+	email := strings.ToLower(addr.Address)
+	if !h.guestEmailLimit.allow(email) {
+		http.Error(w, `{"error":"too many requests, please try again later"}`, http.StatusTooManyRequests)
+		return
+	}
+
+	if err := validateOrder(&req.OrderRequest); err != nil {
+		http.Error(w, `{"error":"`+escapeJSON(err.Error())+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	var address sql.NullString
+	var pickupTime sql.NullTime
+	if req.Address != nil {
+		address = sql.NullString{String: *req.Address, Valid: true}
+	}
+	if req.PickupTime != nil {
+		t, _ := time.Parse(time.RFC3339, *req.PickupTime)
+		pickupTime = sql.NullTime{Time: t, Valid: true}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Insert-then-select so concurrent checkouts for a new email converge on one guest user
+	// instead of one of them failing on the unique index.
+	if _, err := tx.Exec(
+		"INSERT INTO users (email, is_guest) VALUES ($1, TRUE) ON CONFLICT (email) WHERE is_guest DO NOTHING", email,
+	); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	var userID int
+	if err := tx.QueryRow("SELECT id FROM users WHERE email = $1 AND is_guest", email).Scan(&userID); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	var hasAccount bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE lower(email) = $1 AND NOT is_guest)", email).Scan(&hasAccount)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var id int
+	var createdAt time.Time
+	err = tx.QueryRow(
+		`INSERT INTO orders (user_id, preference, address, pickup_time) VALUES ($1, $2, $3, $4)
+		 RETURNING id, created_at`,
+		userID, req.Preference, address, pickupTime,
+	).Scan(&id, &createdAt)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// A guest user whose email already has an account can't be claimed; the owner just logs in.
+	var claimToken string
+	if !hasAccount {
+		claimToken = randomHex(32)
+		_, err = tx.Exec(
+			"INSERT INTO account_claims (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+			hashClaimToken(claimToken), userID, time.Now().Add(claimLinkTTL),
+		)
+		if err != nil {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if hasAccount {
+		go sendGuestEmail(email, "Order placed with your email",
+			"An order was placed with this email address without signing in. It is not linked to your account; "+
+				"log in to place orders you can manage from your account.")
+	} else {
+		go sendGuestEmail(email, "Claim your account",
+			"Thanks for your order. Set a password to manage your orders any time:\r\n\r\n"+claimLink(claimToken))
+	}
+
+	signed, err := h.signToken(&middleware.Claims{UserID: userID, Guest: true, OrderID: id}, guestTokenTTL)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	order := orderToResponse(id, userID, req.Preference, req.Address, req.PickupTime, createdAt)
+	resp := GuestOrderResponse{
+		Order: GuestOrder{
+			ID:         order.ID,
+			Preference: order.Preference,
+			Address:    order.Address,
+			PickupTime: order.PickupTime,
+			CreatedAt:  order.CreatedAt,
+		},
+		Token: signed,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ClaimAccount turns a guest user into a full account using the magic-link token and a new password,
+// and logs them in. Every outstanding link for that user is consumed.
+func (h *Handler) ClaimAccount(w http.ResponseWriter, r *http.Request) {
+	var req ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, `{"error":"token required"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, `{"error":"password must be at least 8 characters"}`, http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(
+		`SELECT user_id FROM account_claims
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() FOR UPDATE`,
+		hashClaimToken(req.Token),
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error":"invalid or expired link"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Guest users can share an email with an account created since checkout; that owner should log in instead.
+	var hasAccount bool
+	err = tx.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM users a JOIN users g ON lower(a.email) = lower(g.email)
+		 WHERE g.id = $1 AND NOT a.is_guest)`,
+		userID,
+	).Scan(&hasAccount)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	if hasAccount {
+		http.Error(w, `{"error":"an account with this email already exists, please log in"}`, http.StatusConflict)
+		return
+	}
+
+	result, err := tx.Exec(
+		"UPDATE users SET password_hash = $1, is_guest = FALSE WHERE id = $2 AND is_guest",
+		string(hash), userID,
+	)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		http.Error(w, `{"error":"account already claimed"}`, http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE account_claims SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	signed, err := h.signToken(&middleware.Claims{UserID: userID}, 24*time.Hour)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{Token: signed})
+}
+
+// hashClaimToken is what we store, so a leaked account_claims table cannot be used to claim accounts.
+func hashClaimToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// claimLink points at the frontend claim page (APP_BASE_URL, default http://localhost:5173).
+func claimLink(token string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+	return strings.TrimRight(base, "/") + "/claim?token=" + token
+}
+
+// smtpTimeout bounds the whole SMTP conversation, from dial to QUIT.
+const smtpTimeout = 30 * time.Second
+
+// sendGuestEmail sends mail via SMTP when SMTP_HOST is set. Bodies can contain account takeover
+// tokens, so without SMTP they are only logged when DEV_LOG_GUEST_EMAILS=true (local development).
+// Callers run it in a goroutine; failures are logged only, since the order has already been placed.
+func sendGuestEmail(to, subject, body string) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		if os.Getenv("DEV_LOG_GUEST_EMAILS") == "true" {
+			log.Printf("guest checkout: SMTP not configured, email to %s (%s): %s", to, subject, body)
+		} else {
+			log.Printf("guest checkout: SMTP not configured, email to %s (%s) not sent", to, subject)
+		}
+		return
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@weel.com"
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", from, to, subject, body)
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	if err := sendMail(net.JoinHostPort(host, port), host, auth, from, to, []byte(msg)); err != nil {
+		log.Printf("guest checkout: sending %q to %s failed: %v", subject, to, err)
+	}
+}
+
+// sendMail is smtp.SendMail with a deadline: smtp.SendMail has no timeouts, so a stalled
+// server would otherwise hold the goroutine (and connection) forever.
+func sendMail(addr, host string, auth smtp.Auth, from, to string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -2,13 +2,33 @@ package handler
 
 import (
 	"database/sql"
+	"net/http"
+	"time"
 )
 
 type Handler struct {
 	db   *sql.DB
 	jwt  string
+	me   *meCache
+
+	deprecated *usageBuffer
+
+	// webhookClient delivers to subscriber URLs and refuses non-public destinations.
+	webhookClient *http.Client
+
+	// Guest checkout is unauthenticated and sends mail, so it is throttled per client IP and per email.
+	guestIPLimit    *rateLimiter
+	guestEmailLimit *rateLimiter
 }
 
 func New(db *sql.DB, jwtSecret string) *Handler {
-	return &Handler{db: db, jwt: jwtSecret}
+	return &Handler{
+		db:              db,
+		jwt:             jwtSecret,
+		me:              newMeCache(),
+		deprecated:      newUsageBuffer(),
+		webhookClient:   newWebhookClient(false),
+		guestIPLimit:    newRateLimiter(20, time.Hour),
+		guestEmailLimit: newRateLimiter(3, time.Hour),
+	}
 }
@@ -2,11 +2,20 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/zeshan-weel/backend/internal/db"
@@ -33,24 +42,42 @@ func testServer(t *testing.T) (*httptest.Server, string) {
 	
 	// Seed test user for login
 	db.SeedTestUser(pool)
+	db.SeedAdminUser(pool)
 
 	jwtSecret := "test-secret"
 	h := New(pool, jwtSecret)
+	// Webhook tests deliver to httptest receivers on 127.0.0.1.
+	h.webhookClient = newWebhookClient(true)
 	auth := middleware.RequireAuth(jwtSecret)
+	admin := middleware.RequireAdmin(jwtSecret)
+	guestOrder := middleware.RequireGuestOrder(jwtSecret)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /auth/login", h.Login)
+	mux.HandleFunc("POST /auth/claim", h.ClaimAccount)
 	mux.HandleFunc("GET /me", auth(h.Me))
 	mux.HandleFunc("POST /orders", auth(h.CreateOrder))
-	mux.HandleFunc("GET /orders/{id}", auth(h.GetOrder))
-	mux.HandleFunc("PUT /orders/{id}", auth(h.UpdateOrder))
-	mux.HandleFunc("GET /orders/{id}/summary", auth(h.OrderSummary))
+	mux.HandleFunc("POST /orders/guest", h.CreateGuestOrder)
+	mux.HandleFunc("GET /orders/{id}", guestOrder(h.GetOrder))
+	mux.HandleFunc("PUT /orders/{id}", guestOrder(h.UpdateOrder))
+	mux.HandleFunc("GET /orders/{id}/summary", guestOrder(h.OrderSummary))
+	mux.HandleFunc("GET /admin/webhooks", admin(h.ListWebhooks))
+	mux.HandleFunc("POST /admin/webhooks", admin(h.CreateWebhook))
+	mux.HandleFunc("POST /admin/webhooks/{id}/test", admin(h.TestWebhook))
+	mux.HandleFunc("POST /admin/orders/{id}/lock", admin(h.LockOrder))
+	mux.HandleFunc("DELETE /admin/orders/{id}/lock", admin(h.UnlockOrder))
+	mux.HandleFunc("GET /admin/deprecations", admin(h.DeprecationReport))
 
 	srv := httptest.NewServer(middleware.CORS(mux))
 	t.Cleanup(srv.Close)
 
-	// Login to get token
-	loginBody := `{"email":"user@weel.com","password":"password"}`
+	return srv, login(t, srv, "user@weel.com")
+}
+
+// login returns a token for a seeded user (password "password").
+func login(t *testing.T, srv *httptest.Server, email string) string {
+	t.Helper()
+	loginBody := `{"email":"` + email + `","password":"password"}`
 	resp, err := http.Post(srv.URL+"/auth/login", "application/json", bytes.NewBufferString(loginBody))
 	if err != nil {
 		t.Fatalf("login request: %v", err)
@@ -65,7 +92,7 @@ func testServer(t *testing.T) (*httptest.Server, string) {
 		t.Fatalf("decode login: %v", err)
 	}
 	resp.Body.Close()
-	return srv, loginResp.Token
+	return loginResp.Token
 }
 
 func TestLoginSuccess(t *testing.T) {
@@ -266,3 +293,912 @@ func TestOrderSummaryReturnsFallbackWhenNoAIKey(t *testing.T) {
 		t.Errorf("expected source fallback when no AI key, got %q", summaryResp.Source)
 	}
 }
+
+func TestSignWebhookPayload(t *testing.T) {
+	// HMAC-SHA256("secret", "1700000000.{}")
+	got := signWebhookPayload("secret", 1700000000, []byte("{}"))
+	want := "b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got != want {
+		t.Errorf("signature: want %s, got %s", want, got)
+	}
+}
+
+func TestDeliverWebhookDoesNotFollowRedirects(t *testing.T) {
+	forwarded := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = true
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	out := deliverWebhook(newWebhookClient(true), receiver.URL, "secret", WebhookOrderCreated, []byte("{}"))
+	if out.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("want receiver's 307 reported, got %d (error %q)", out.StatusCode, out.Error)
+	}
+	if forwarded {
+		t.Error("signed payload was forwarded to the redirect target")
+	}
+}
+
+func TestDeliverWebhookRefusesPrivateAddresses(t *testing.T) {
+	reached := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.Write([]byte("internal"))
+	}))
+	defer receiver.Close()
+
+	out := deliverWebhook(newWebhookClient(false), receiver.URL, "secret", WebhookOrderCreated, []byte("{}"))
+	if reached || out.StatusCode != 0 || out.Body != "" {
+		t.Errorf("loopback receiver was called: status %d, body %q", out.StatusCode, out.Body)
+	}
+	if !strings.Contains(out.Error, errWebhookDestination.Error()) {
+		t.Errorf("want destination error, got %q", out.Error)
+	}
+
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "192.168.0.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "::ffff:10.0.0.1"} {
+		if publicAddr(netip.MustParseAddr(addr)) {
+			t.Errorf("%s should not be treated as public", addr)
+		}
+	}
+	if !publicAddr(netip.MustParseAddr("93.184.216.34")) {
+		t.Error("93.184.216.34 should be treated as public")
+	}
+}
+
+func TestWebhookTestRequiresAdmin(t *testing.T) {
+	srv, token := testServer(t)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/webhooks/1/test", bytes.NewBufferString(`{"event":"order.created"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("non-admin: want 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookTestDeliversSignedPayload(t *testing.T) {
+	srv, _ := testServer(t)
+	adminToken := login(t, srv, "admin@weel.com")
+
+	var gotEvent, gotSignature string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEvent = r.Header.Get("X-Webhook-Event")
+		gotSignature = r.Header.Get("X-Webhook-Signature")
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("ok"))
+	}))
+	defer receiver.Close()
+
+	pool, err := db.Open()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	defer pool.Close()
+	createReq, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/webhooks",
+		bytes.NewBufferString(`{"url":"`+receiver.URL+`"}`))
+	createReq.Header.Set("Authorization", "Bearer "+adminToken)
+	createResp, err := http.DefaultClient.Do(createReq)
+	if err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	defer createResp.Body.Close()
+	if createResp.StatusCode != http.StatusCreated {
+		t.Fatalf("create subscription: want 201, got %d", createResp.StatusCode)
+	}
+	var sub WebhookSubscription
+	if err := json.NewDecoder(createResp.Body).Decode(&sub); err != nil {
+		t.Fatalf("decode subscription: %v", err)
+	}
+	if sub.Secret == "" {
+		t.Error("expected a signing secret on create")
+	}
+	subID := sub.ID
+	t.Cleanup(func() { pool.Exec("DELETE FROM webhook_subscriptions WHERE id = $1", subID) })
+
+	listReq, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin/webhooks", nil)
+	listReq.Header.Set("Authorization", "Bearer "+adminToken)
+	listResp, err := http.DefaultClient.Do(listReq)
+	if err != nil {
+		t.Fatalf("list subscriptions: %v", err)
+	}
+	defer listResp.Body.Close()
+	var subs []WebhookSubscription
+	if err := json.NewDecoder(listResp.Body).Decode(&subs); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	listed := false
+	for _, s := range subs {
+		if s.ID == subID {
+			listed = true
+			if s.Secret != "" {
+				t.Error("list must not return secrets")
+			}
+		}
+	}
+	if !listed {
+		t.Errorf("subscription %d not listed", subID)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/webhooks/"+strconv.Itoa(subID)+"/test",
+		bytes.NewBufferString(`{"event":"order.updated"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %d", resp.StatusCode)
+	}
+	var out struct {
+		StatusCode int    `json:"status_code"`
+		Body       string `json:"body"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.StatusCode != http.StatusAccepted || out.Body != "ok" {
+		t.Errorf("want receiver response 202 ok, got %d %q", out.StatusCode, out.Body)
+	}
+	if gotEvent != "order.updated" {
+		t.Errorf("X-Webhook-Event: want order.updated, got %q", gotEvent)
+	}
+	if gotSignature == "" {
+		t.Error("expected X-Webhook-Signature header")
+	}
+}
+
+func TestLockedOrderRejectsCustomerEdits(t *testing.T) {
+	srv, token := testServer(t)
+	adminToken := login(t, srv, "admin@weel.com")
+
+	do := func(method, path, tok, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tok)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	createResp := do(http.MethodPost, "/orders", token, `{"preference":"IN_STORE"}`)
+	if createResp.StatusCode != http.StatusCreated {
+		t.Fatalf("create order want 201, got %d", createResp.StatusCode)
+	}
+	var orderResp struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(createResp.Body).Decode(&orderResp); err != nil {
+		t.Fatalf("decode order: %v", err)
+	}
+	orderPath := "/orders/" + strconv.Itoa(orderResp.ID)
+
+	if resp := do(http.MethodPost, "/admin"+orderPath+"/lock", token, ""); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("customer lock: want 403, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/admin"+orderPath+"/lock", adminToken, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("lock: want 200, got %d", resp.StatusCode)
+	}
+	// Renewing our own lock succeeds.
+	if resp := do(http.MethodPost, "/admin"+orderPath+"/lock", adminToken, ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("renew lock: want 200, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPut, orderPath, token, `{"preference":"IN_STORE"}`); resp.StatusCode != http.StatusLocked {
+		t.Errorf("update while locked: want 423, got %d", resp.StatusCode)
+	}
+
+	if resp := do(http.MethodDelete, "/admin"+orderPath+"/lock", adminToken, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unlock: want 204, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPut, orderPath, token, `{"preference":"IN_STORE"}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("update after unlock: want 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestGuestCheckoutTokenScopedToOrder(t *testing.T) {
+	srv, token := testServer(t)
+
+	email := "guest-" + strconv.FormatInt(time.Now().UnixNano(), 10) + "@example.com"
+	resp, err := http.Post(srv.URL+"/orders/guest", "application/json",
+		bytes.NewBufferString(`{"email":"`+email+`","preference":"IN_STORE"}`))
+	if err != nil {
+		t.Fatalf("guest order: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("guest order: want 201, got %d", resp.StatusCode)
+	}
+	var guest struct {
+		Order struct {
+			ID int `json:"id"`
+		} `json:"order"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&guest); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	// An order belonging to the regular test user.
+	createReq, _ := http.NewRequest(http.MethodPost, srv.URL+"/orders", bytes.NewBufferString(`{"preference":"IN_STORE"}`))
+	createReq.Header.Set("Authorization", "Bearer "+token)
+	createResp, err := http.DefaultClient.Do(createReq)
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	defer createResp.Body.Close()
+	var other struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(createResp.Body).Decode(&other); err != nil {
+		t.Fatalf("decode order: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/orders/" + strconv.Itoa(guest.Order.ID), http.StatusOK},
+		{"/orders/" + strconv.Itoa(other.ID), http.StatusForbidden},
+		{"/me", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+guest.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("guest GET %s: want %d, got %d", tt.path, tt.want, resp.StatusCode)
+		}
+	}
+
+}
+
+func TestGuestCheckoutDoesNotRevealAccounts(t *testing.T) {
+	srv, token := testServer(t)
+
+	countOrders := func() int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("list orders: %v", err)
+		}
+		defer resp.Body.Close()
+		var list []json.RawMessage
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatalf("decode orders: %v", err)
+		}
+		return len(list)
+	}
+	guestOrder := func(email string) (int, map[string]any) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/orders/guest", "application/json",
+			bytes.NewBufferString(`{"email":"`+email+`","preference":"DELIVERY","address":"1 Main St"}`))
+		if err != nil {
+			t.Fatalf("guest order: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.StatusCode, out
+	}
+
+	before := countOrders()
+	accountStatus, account := guestOrder("User@Weel.com")
+	newStatus, fresh := guestOrder("new-" + strconv.FormatInt(time.Now().UnixNano(), 10) + "@example.com")
+
+	if accountStatus != newStatus {
+		t.Errorf("status: existing account %d, new email %d", accountStatus, newStatus)
+	}
+	if len(account) != len(fresh) {
+		t.Errorf("top-level fields differ: %v vs %v", account, fresh)
+	}
+	if _, ok := account["token"].(string); !ok {
+		t.Error("existing account: missing token")
+	}
+	if _, ok := fresh["token"].(string); !ok {
+		t.Error("new email: missing token")
+	}
+	accountOrder, _ := account["order"].(map[string]any)
+	freshOrder, _ := fresh["order"].(map[string]any)
+	if len(accountOrder) != len(freshOrder) {
+		t.Errorf("order fields differ: %v vs %v", accountOrder, freshOrder)
+	}
+	for field, v := range freshOrder {
+		av, ok := accountOrder[field]
+		switch field {
+		case "id", "created_at":
+			// Fresh per order; only presence must match.
+			if !ok {
+				t.Errorf("existing account: order.%s missing", field)
+			}
+		default:
+			if av != v {
+				t.Errorf("order.%s: existing account %v, new email %v", field, av, v)
+			}
+		}
+	}
+	if _, ok := freshOrder["user_id"]; ok {
+		t.Error("guest response must not include user_id")
+	}
+
+	if got := countOrders(); got != before {
+		t.Errorf("guest checkout wrote to the full account: %d orders before, %d after", before, got)
+	}
+}
+
+func TestGuestCheckoutNormalizesEmail(t *testing.T) {
+	srv, _ := testServer(t)
+
+	email := "case-" + strconv.FormatInt(time.Now().UnixNano(), 10) + "@example.com"
+	for _, e := range []string{strings.ToUpper(email), email} {
+		resp, err := http.Post(srv.URL+"/orders/guest", "application/json",
+			bytes.NewBufferString(`{"email":"`+e+`","preference":"IN_STORE"}`))
+		if err != nil {
+			t.Fatalf("guest order: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("guest order %s: want 201, got %d", e, resp.StatusCode)
+		}
+	}
+
+	pool, err := db.Open()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	defer pool.Close()
+	var users int
+	if err := pool.QueryRow("SELECT COUNT(*) FROM users WHERE lower(email) = $1", email).Scan(&users); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if users != 1 {
+		t.Errorf("want one guest user for both spellings, got %d", users)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(3, time.Hour)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.allow("a") {
+			t.Fatalf("hit %d: want allowed", i+1)
+		}
+	}
+	if l.allow("a") {
+		t.Error("4th hit in window: want throttled")
+	}
+	if !l.allow("b") {
+		t.Error("other key: want allowed")
+	}
+	now = now.Add(time.Hour)
+	if !l.allow("a") {
+		t.Error("next window: want allowed")
+	}
+}
+
+func TestClaimGuestAccount(t *testing.T) {
+	srv, _ := testServer(t)
+
+	email := "claim-" + strconv.FormatInt(time.Now().UnixNano(), 10) + "@example.com"
+	resp, err := http.Post(srv.URL+"/orders/guest", "application/json",
+		bytes.NewBufferString(`{"email":"`+email+`","preference":"IN_STORE"}`))
+	if err != nil {
+		t.Fatalf("guest order: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("guest order: want 201, got %d", resp.StatusCode)
+	}
+
+	// The real link is only emailed, so plant a known token for this guest.
+	pool, err := db.Open()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	defer pool.Close()
+	if _, err := pool.Exec(
+		`INSERT INTO account_claims (token_hash, user_id, expires_at)
+		 SELECT $1, id, NOW() + INTERVAL '1 hour' FROM users WHERE email = $2`,
+		hashClaimToken("claim-"+email), email,
+	); err != nil {
+		t.Fatalf("insert claim: %v", err)
+	}
+
+	resp, err = http.Post(srv.URL+"/auth/login", "application/json",
+		bytes.NewBufferString(`{"email":"`+email+`","password":"new-password"}`))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login before claim: want 401, got %d", resp.StatusCode)
+	}
+
+	claimBody := `{"token":"claim-` + email + `","password":"new-password"}`
+	resp, err = http.Post(srv.URL+"/auth/claim", "application/json", bytes.NewBufferString(claimBody))
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("claim: want 200, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(srv.URL+"/auth/claim", "application/json", bytes.NewBufferString(claimBody))
+	if err != nil {
+		t.Fatalf("reuse claim: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reused link: want 400, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(srv.URL+"/auth/login", "application/json",
+		bytes.NewBufferString(`{"email":"`+email+`","password":"new-password"}`))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("login after claim: want 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestMeCacheLoadsOncePerTTL(t *testing.T) {
+	c := newMeCache()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	loads := 0
+	load := func() ([]byte, error) {
+		loads++
+		return []byte(`{"id":1,"email":"user@weel.com"}`), nil
+	}
+
+	// 100 page loads within the TTL cost one DB read instead of 100.
+	var first meCacheEntry
+	for i := 0; i < 100; i++ {
+		e, err := c.get(1, load)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if i == 0 {
+			first = e
+		} else if e.etag != first.etag {
+			t.Fatalf("etag changed between cached reads: %s vs %s", first.etag, e.etag)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("within TTL: want 1 load, got %d", loads)
+	}
+
+	c.invalidate(1)
+	c.get(1, load)
+	if loads != 2 {
+		t.Errorf("after invalidate: want 2 loads, got %d", loads)
+	}
+
+	now = now.Add(meCacheTTL)
+	c.get(1, load)
+	if loads != 3 {
+		t.Errorf("after expiry: want 3 loads, got %d", loads)
+	}
+
+	if _, err := c.get(2, func() ([]byte, error) { return nil, errors.New("no rows") }); err == nil {
+		t.Error("expected load error to be returned")
+	}
+	if _, ok := c.entries[2]; ok {
+		t.Error("failed load must not be cached")
+	}
+}
+
+func TestMeCacheDropsLoadRacingInvalidate(t *testing.T) {
+	c := newMeCache()
+	loads := 0
+
+	// The profile changes (and invalidate runs) while the first load is in flight.
+	c.get(1, func() ([]byte, error) {
+		loads++
+		c.invalidate(1)
+		return []byte(`{"id":1,"email":"old@weel.com"}`), nil
+	})
+	e, _ := c.get(1, func() ([]byte, error) {
+		loads++
+		return []byte(`{"id":1,"email":"new@weel.com"}`), nil
+	})
+	if loads != 2 {
+		t.Errorf("want the stale load dropped and a reload, got %d loads", loads)
+	}
+	if string(e.body) != `{"id":1,"email":"new@weel.com"}` {
+		t.Errorf("want fresh body, got %s", e.body)
+	}
+	if len(c.loading) != 0 || len(c.gens) != 0 {
+		t.Errorf("want no bookkeeping left once loads finish, got loading %v gens %v", c.loading, c.gens)
+	}
+
+	// Invalidating with no load in flight leaves nothing behind either.
+	c.invalidate(2)
+	if len(c.gens) != 0 {
+		t.Errorf("idle invalidate: want gens empty, got %v", c.gens)
+	}
+}
+
+// countingDB is a database/sql connector that answers every query with one row of the given
+// columns and counts the queries that reach the driver, so handlers can run without Postgres.
+type countingDB struct {
+	queries atomic.Int64
+	columns []string
+	row     []driver.Value
+}
+
+func (d *countingDB) Connect(context.Context) (driver.Conn, error) { return countingConn{d}, nil }
+func (d *countingDB) Driver() driver.Driver                         { return nil }
+
+type countingConn struct{ d *countingDB }
+
+func (c countingConn) Prepare(string) (driver.Stmt, error) { return countingStmt(c), nil }
+func (c countingConn) Close() error                        { return nil }
+func (c countingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type countingStmt struct{ d *countingDB }
+
+func (s countingStmt) Close() error                               { return nil }
+func (s countingStmt) NumInput() int                              { return -1 }
+func (s countingStmt) Exec([]driver.Value) (driver.Result, error) { return nil, errors.New("not supported") }
+func (s countingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.queries.Add(1)
+	return &oneRow{columns: s.d.columns, row: s.d.row}, nil
+}
+
+type oneRow struct {
+	columns []string
+	row     []driver.Value
+	done    bool
+}
+
+func (r *oneRow) Columns() []string { return r.columns }
+func (r *oneRow) Close() error      { return nil }
+func (r *oneRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
+
+func TestMeDBQueriesWithCache(t *testing.T) {
+	const requests = 100
+	measure := func(ttl time.Duration) int64 {
+		conn := &countingDB{columns: []string{"email"}, row: []driver.Value{"user@weel.com"}}
+		pool := sql.OpenDB(conn)
+		defer pool.Close()
+		h := New(pool, "test-secret")
+		h.me.ttl = ttl
+
+		for i := 0; i < requests; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+			w := httptest.NewRecorder()
+			h.Me(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("/me: want 200, got %d", w.Code)
+			}
+		}
+		return conn.queries.Load()
+	}
+
+	// A zero TTL reproduces the old behaviour: one SELECT per request.
+	before := measure(0)
+	after := measure(meCacheTTL)
+	t.Logf("%d /me requests for one user: %d DB queries uncached, %d with cache", requests, before, after)
+	if before != requests {
+		t.Errorf("uncached: want %d queries, got %d", requests, before)
+	}
+	if after != 1 {
+		t.Errorf("cached: want 1 query, got %d", after)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"x", "abc"`, true},
+		{`*`, true},
+		{`"x"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q): want %v, got %v", tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestMeConditionalRequest(t *testing.T) {
+	srv, token := testServer(t)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %d", resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected ETag header")
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "private, max-age=30" {
+		t.Errorf("Cache-Control: want private, max-age=30, got %q", cc)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("matching If-None-Match: want 304, got %d", resp.StatusCode)
+	}
+}
+
+type fakeUsageRecorder struct {
+	route, client string
+}
+
+func (f *fakeUsageRecorder) RecordDeprecatedUsage(route, client string) {
+	f.route, f.client = route, client
+}
+
+func TestDeprecatedRouteHeaders(t *testing.T) {
+	rec := &fakeUsageRecorder{}
+	d := middleware.Deprecation{
+		Route:  "GET /legacy",
+		Since:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+		Link:   "https://example.com/migrate",
+	}
+	auth := middleware.RequireAuth("test-secret")
+	h := auth(middleware.Deprecated(d, rec)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	token, err := (&Handler{jwt: "test-secret"}).signToken(&middleware.Claims{UserID: 42}, time.Hour)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/legacy", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h(w, req)
+
+	if got := w.Header().Get("Deprecation"); got != "@1767225600" {
+		t.Errorf("Deprecation: want @1767225600, got %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Wed, 01 Jul 2026 00:00:00 GMT" {
+		t.Errorf("Sunset: got %q", got)
+	}
+	if got := w.Header().Get("Link"); got != `<https://example.com/migrate>; rel="deprecation"` {
+		t.Errorf("Link: got %q", got)
+	}
+	if rec.route != "GET /legacy" || rec.client != "user:42" {
+		t.Errorf("recorded usage: want GET /legacy by user:42, got %s by %s", rec.route, rec.client)
+	}
+}
+
+func TestDeprecationWithoutSince(t *testing.T) {
+	w := httptest.NewRecorder()
+	middleware.MarkDeprecated(w, httptest.NewRequest(http.MethodGet, "/legacy", nil), middleware.Deprecation{Route: "GET /legacy"}, nil)
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("zero Since: want Deprecation true, got %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "" {
+		t.Errorf("zero Sunset: want no header, got %q", got)
+	}
+}
+
+func TestGetOrderMarksUserIDDeprecated(t *testing.T) {
+	conn := &countingDB{
+		columns: []string{"preference", "address", "pickup_time", "created_at"},
+		row:     []driver.Value{PrefInStore, nil, nil, time.Now()},
+	}
+	pool := sql.OpenDB(conn)
+	defer pool.Close()
+	h := New(pool, "test-secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/7", nil)
+	req.SetPathValue("id", "7")
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 3))
+	w := httptest.NewRecorder()
+	h.GetOrder(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d", w.Code)
+	}
+	if got, want := w.Header().Get("Deprecation"), "@"+strconv.FormatInt(orderUserIDDeprecation.Since.Unix(), 10); got != want {
+		t.Errorf("Deprecation: want %s, got %q", want, got)
+	}
+	var order OrderResponse
+	if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if order.UserID != 3 {
+		t.Errorf("user_id is deprecated, not removed: want 3, got %d", order.UserID)
+	}
+	counts, _ := h.deprecated.take()
+	if got := counts[usageKey{"GET /orders/{id}#user_id", "user:3"}].calls; got != 1 {
+		t.Errorf("want one recorded call by user:3, got %d", got)
+	}
+}
+
+func TestUsageBufferCapped(t *testing.T) {
+	b := newUsageBuffer()
+	now := time.Now()
+	one := usageCount{calls: 1, firstSeen: now, lastSeen: now}
+	for i := 0; i < deprecatedUsageMaxKeys; i++ {
+		b.add(usageKey{"GET /legacy", "ip:" + strconv.Itoa(i)}, one)
+	}
+	b.add(usageKey{"GET /legacy", "ip:overflow"}, one)
+	b.add(usageKey{"GET /legacy", "ip:0"}, one)
+
+	counts, dropped := b.take()
+	if len(counts) != deprecatedUsageMaxKeys {
+		t.Errorf("want %d keys, got %d", deprecatedUsageMaxKeys, len(counts))
+	}
+	if dropped != 1 {
+		t.Errorf("want 1 dropped call, got %d", dropped)
+	}
+	if got := counts[usageKey{"GET /legacy", "ip:0"}].calls; got != 2 {
+		t.Errorf("existing key past the cap: want 2 calls, got %d", got)
+	}
+}
+
+func TestRecordDeprecatedUsageBuffersInMemory(t *testing.T) {
+	// No DB: recording must not touch it.
+	h := New(nil, "test-secret")
+	h.RecordDeprecatedUsage("GET /legacy", "user:1")
+	h.RecordDeprecatedUsage("GET /legacy", "user:1")
+	h.RecordDeprecatedUsage("GET /legacy", "ip:10.0.0.1")
+
+	counts, _ := h.deprecated.take()
+	if got := counts[usageKey{"GET /legacy", "user:1"}].calls; got != 2 {
+		t.Errorf("user:1: want 2 calls, got %d", got)
+	}
+	if got := counts[usageKey{"GET /legacy", "ip:10.0.0.1"}].calls; got != 1 {
+		t.Errorf("ip:10.0.0.1: want 1 call, got %d", got)
+	}
+	if counts, _ := h.deprecated.take(); len(counts) != 0 {
+		t.Error("take must reset the buffer")
+	}
+}
+
+func TestDeprecationReport(t *testing.T) {
+	srv, token := testServer(t)
+	adminToken := login(t, srv, "admin@weel.com")
+
+	pool, err := db.Open()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	defer pool.Close()
+	route := "GET /test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	h := New(pool, "test-secret")
+	h.RecordDeprecatedUsage(route, "user:1")
+	h.RecordDeprecatedUsage(route, "user:1")
+	h.FlushDeprecatedUsage()
+	t.Cleanup(func() { pool.Exec("DELETE FROM deprecated_route_usage WHERE route = $1", route) })
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin/deprecations", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("non-admin: want 403, got %d", resp.StatusCode)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	var report []struct {
+		Route  string `json:"route"`
+		Client string `json:"client"`
+		Calls  int64  `json:"calls"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, u := range report {
+		if u.Route == route {
+			if u.Client != "user:1" || u.Calls != 2 {
+				t.Errorf("want user:1 with 2 calls, got %s with %d", u.Client, u.Calls)
+			}
+			return
+		}
+	}
+	t.Errorf("route %s missing from report", route)
+}
+
+func TestDeprecatedOrderUserIDReported(t *testing.T) {
+	srv, token := testServer(t)
+	adminToken := login(t, srv, "admin@weel.com")
+
+	do := func(method, path, tok, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+tok)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/orders", token, `{"preference":"IN_STORE"}`)
+	var order OrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		t.Fatalf("decode order: %v", err)
+	}
+	resp.Body.Close()
+
+	resp = do(http.MethodGet, "/orders/"+strconv.Itoa(order.ID), token, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get order: want 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Deprecation") == "" {
+		t.Error("GET /orders/{id}: expected Deprecation header for user_id")
+	}
+
+	resp = do(http.MethodGet, "/admin/deprecations", adminToken, "")
+	defer resp.Body.Close()
+	var report []DeprecatedUsage
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	client := "user:" + strconv.Itoa(order.UserID)
+	for _, u := range report {
+		if u.Route == orderUserIDDeprecation.Route && u.Client == client {
+			return
+		}
+	}
+	t.Errorf("%s by %s missing from report", orderUserIDDeprecation.Route, client)
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zeshan-weel/backend/internal/middleware"
+)
+
+// orderLockTTL is how long a staff lock lasts without renewal; the admin UI re-posts the lock while the order is open.
+const orderLockTTL = 2 * time.Minute
+
+type OrderLockResponse struct {
+	OrderID   int       `json:"order_id"`
+	LockedBy  int       `json:"locked_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LockOrder acquires or renews an advisory lock on an order for the calling staff member.
+// Customer edits are rejected with 423 until the lock is released or expires.
+// Another staff member's live lock is reported as 409.
+func (h *Handler) LockOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFrom(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid id"}`, http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1)", id).Scan(&exists); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+
+	// Take the lock if free or expired; renew it if we already hold it.
+	// Expiry is computed and checked on the database clock so app/DB skew cannot stretch or shrink locks.
+	var expiresAt time.Time
+	err = h.db.QueryRow(
+		`INSERT INTO order_locks (order_id, locked_by, expires_at) VALUES ($1, $2, NOW() + $3::int * INTERVAL '1 second')
+		 ON CONFLICT (order_id) DO UPDATE SET locked_by = EXCLUDED.locked_by, expires_at = EXCLUDED.expires_at
+		 WHERE order_locks.locked_by = EXCLUDED.locked_by OR order_locks.expires_at <= NOW()
+		 RETURNING expires_at`,
+		id, userID, int(orderLockTTL.Seconds()),
+	).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error":"order is locked by another staff member"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OrderLockResponse{OrderID: id, LockedBy: userID, ExpiresAt: expiresAt})
+}
+
+// UnlockOrder releases the caller's lock early (e.g. when the admin UI closes the order).
+// Releasing a lock that is not held is a no-op.
+func (h *Handler) UnlockOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFrom(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid id"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.db.Exec("DELETE FROM order_locks WHERE order_id = $1 AND locked_by = $2", id, userID); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// orderLocked reports whether staff hold a live lock on the user's order.
+// UpdateOrder uses it only to explain why its guarded UPDATE matched nothing.
+func (h *Handler) orderLocked(orderID, userID int) (bool, error) {
+	var locked bool
+	err := h.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM order_locks l JOIN orders o ON o.id = l.order_id
+		 WHERE l.order_id = $1 AND o.user_id = $2 AND l.expires_at > NOW())`,
+		orderID, userID,
+	).Scan(&locked)
+	return locked, err
+}
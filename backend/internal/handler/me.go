@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/zeshan-weel/backend/internal/middleware"
 )
@@ -12,6 +13,8 @@ type MeResponse struct {
 	Email string `json:"email"`
 }
 
+// Me is fetched on every page load, so responses come from h.me (one DB read per user per meCacheTTL)
+// and carry private caching headers plus an ETag for conditional requests.
 func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.UserIDFrom(r.Context())
 	if !ok {
@@ -19,13 +22,26 @@ func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var email string
-	err := h.db.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email)
+	entry, err := h.me.get(userID, func() ([]byte, error) {
+		var email string
+		if err := h.db.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(MeResponse{ID: userID, Email: email})
+		return append(body, '\n'), err
+	})
 	if err != nil {
 		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
 		return
 	}
 
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(meCacheTTL.Seconds())))
+	w.Header().Set("Vary", "Authorization")
+	w.Header().Set("ETag", entry.etag)
+	if etagMatches(r.Header.Get("If-None-Match"), entry.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(MeResponse{ID: userID, Email: email})
+	w.Write(entry.body)
 }
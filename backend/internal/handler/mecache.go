@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// meCacheTTL bounds how stale a cached /me body can be; it also sets the browser's max-age.
+const meCacheTTL = 30 * time.Second
+
+// meCacheMaxEntries caps memory; past it, expired entries are swept and, if still full, the cache is reset.
+const meCacheMaxEntries = 10000
+
+type meCacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// meCache is an in-process cache of encoded /me responses keyed by user id.
+// /me returns id and email, and no endpoint changes either today; an endpoint that changes a
+// user's email (or any field added to MeResponse) must call invalidate after its write commits.
+type meCache struct {
+	mu      sync.Mutex
+	entries map[int]meCacheEntry
+	// loading counts in-flight loads per user and gens is bumped by invalidate while any are in
+	// flight, so a load that started before an invalidation is not stored. Both entries are
+	// removed when a user's last load finishes, so they only hold users being loaded right now.
+	loading map[int]int
+	gens    map[int]uint64
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+func newMeCache() *meCache {
+	return &meCache{
+		entries: make(map[int]meCacheEntry),
+		loading: make(map[int]int),
+		gens:    make(map[int]uint64),
+		ttl:     meCacheTTL,
+		now:     time.Now,
+	}
+}
+
+// get returns the cached entry for userID, calling load (the DB read) only on a miss or after expiry.
+func (c *meCache) get(userID int, load func() ([]byte, error)) (meCacheEntry, error) {
+	c.mu.Lock()
+	e, ok := c.entries[userID]
+	if ok && c.now().Before(e.expires) {
+		c.mu.Unlock()
+		return e, nil
+	}
+	gen := c.gens[userID]
+	c.loading[userID]++
+	c.mu.Unlock()
+
+	body, err := load()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stale := c.gens[userID] != gen
+	c.loading[userID]--
+	if c.loading[userID] == 0 {
+		delete(c.loading, userID)
+		delete(c.gens, userID)
+	}
+	if err != nil {
+		return meCacheEntry{}, err
+	}
+	sum := sha256.Sum256(body)
+	e = meCacheEntry{body: body, etag: `"` + hex.EncodeToString(sum[:8]) + `"`, expires: c.now().Add(c.ttl)}
+	if stale {
+		// Invalidated while loading: serve this response but don't cache possibly stale data.
+		return e, nil
+	}
+	if len(c.entries) >= meCacheMaxEntries {
+		c.sweepLocked()
+	}
+	c.entries[userID] = e
+	return e, nil
+}
+
+func (c *meCache) invalidate(userID int) {
+	c.mu.Lock()
+	delete(c.entries, userID)
+	if c.loading[userID] > 0 {
+		c.gens[userID]++
+	}
+	c.mu.Unlock()
+}
+
+func (c *meCache) sweepLocked() {
+	now := c.now()
+	for id, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, id)
+		}
+	}
+	if len(c.entries) >= meCacheMaxEntries {
+		c.entries = make(map[int]meCacheEntry)
+	}
+}
+
+// etagMatches implements If-None-Match's weak comparison against a single ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -19,6 +19,12 @@ const (
 
 var validPrefs = map[string]bool{PrefInStore: true, PrefDelivery: true, PrefCurbside: true}
 
+// orderUserIDDeprecation covers user_id in GET /orders/{id}: it is always the caller's own id, which /me returns.
+var orderUserIDDeprecation = middleware.Deprecation{
+	Route: "GET /orders/{id}#user_id",
+	Since: time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC),
+}
+
 type OrderRequest struct {
 	Preference  string  `json:"preference"`
 	Address     *string `json:"address"`
@@ -170,6 +176,7 @@ func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		timePtr = &s
 	}
 	resp := orderToResponse(id, userID, preference, addrPtr, timePtr, createdAt)
+	middleware.MarkDeprecated(w, r, orderUserIDDeprecation, h)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
@@ -209,8 +216,10 @@ func (h *Handler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 		pickupTime = sql.NullTime{Time: t, Valid: true}
 	}
 
+	// The lock check is part of the UPDATE so staff taking the lock cannot race a customer edit.
 	result, err := h.db.Exec(
-		`UPDATE orders SET preference = $1, address = $2, pickup_time = $3 WHERE id = $4 AND user_id = $5`,
+		`UPDATE orders SET preference = $1, address = $2, pickup_time = $3 WHERE id = $4 AND user_id = $5
+		 AND NOT EXISTS (SELECT 1 FROM order_locks WHERE order_id = $4 AND expires_at > NOW())`,
 		req.Preference, address, pickupTime, id, userID,
 	)
 	if err != nil {
@@ -219,6 +228,16 @@ func (h *Handler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
+		// Nothing updated: either the order is locked or it is not the user's.
+		locked, err := h.orderLocked(id, userID)
+		if err != nil {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		if locked {
+			http.Error(w, `{"error":"order is locked: staff is modifying it, please try again shortly"}`, http.StatusLocked)
+			return
+		}
 		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
 		return
 	}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiterMaxKeys caps memory; past it, finished windows are swept.
+const rateLimiterMaxKeys = 10000
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter is a fixed-window, in-process limiter keyed by arbitrary strings (client IP, email, ...).
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string]rateWindow
+	now    func() time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, hits: make(map[string]rateWindow), now: time.Now}
+}
+
+// allow counts a hit for key and reports whether it is within the limit for the current window.
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.hits) >= rateLimiterMaxKeys {
+		for k, w := range l.hits {
+			if now.Sub(w.start) >= l.window {
+				delete(l.hits, k)
+			}
+		}
+	}
+	w, ok := l.hits[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = rateWindow{start: now}
+	}
+	w.count++
+	l.hits[key] = w
+	return w.count <= l.limit
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	WebhookOrderCreated = "order.created"
+	WebhookOrderUpdated = "order.updated"
+)
+
+var validWebhookEvents = map[string]bool{WebhookOrderCreated: true, WebhookOrderUpdated: true}
+
+// webhookHTTPTimeout bounds how long we wait on a subscriber's receiver.
+const webhookHTTPTimeout = 10 * time.Second
+
+// webhookMaxResponseBody caps how much of the subscriber's response is echoed back.
+const webhookMaxResponseBody = 64 << 10
+
+// errWebhookDestination is returned when a subscriber URL resolves to an address we refuse to call.
+var errWebhookDestination = errors.New("webhook destination is not a public address")
+
+type WebhookSubscriptionRequest struct {
+	URL string `json:"url"`
+}
+
+// WebhookSubscription is a subscriber endpoint. Secret is only returned when the subscription is created.
+type WebhookSubscription struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookTestRequest struct {
+	Event string `json:"event"`
+}
+
+// WebhookEvent is the payload delivered to subscribers.
+type WebhookEvent struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	Test      bool          `json:"test"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      OrderResponse `json:"data"`
+}
+
+// WebhookTestResponse reports what the subscriber's receiver answered.
+// Error is set (and StatusCode left zero) when the request never got a response.
+type WebhookTestResponse struct {
+	Event      string `json:"event"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Body       string `json:"body"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// CreateWebhook registers a subscriber URL and returns it with a generated signing secret.
+// The secret is shown only here; subscribers use it to verify X-Webhook-Signature.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, `{"error":"url must be an absolute http or https URL"}`, http.StatusBadRequest)
+		return
+	}
+
+	sub := WebhookSubscription{URL: u.String(), Secret: "whsec_" + randomHex(24)}
+	err = h.db.QueryRow(
+		"INSERT INTO webhook_subscriptions (url, secret) VALUES ($1, $2) RETURNING id, created_at",
+		sub.URL, sub.Secret,
+	).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// ListWebhooks returns all subscriptions without their secrets.
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query("SELECT id, url, created_at FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var list []WebhookSubscription
+	for rows.Next() {
+		var sub WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.URL, &sub.CreatedAt); err != nil {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		list = append(list, sub)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []WebhookSubscription{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// TestWebhook sends a sample signed event to a subscriber so integrators can verify their receiver
+// without placing real orders. Delivery failures are reported in the response body, not as an HTTP error.
+func (h *Handler) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id < 1 {
+		http.Error(w, `{"error":"invalid id"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req WebhookTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	if !validWebhookEvents[req.Event] {
+		http.Error(w, `{"error":"event must be order.created or order.updated"}`, http.StatusBadRequest)
+		return
+	}
+
+	var url, secret string
+	err = h.db.QueryRow("SELECT url, secret FROM webhook_subscriptions WHERE id = $1", id).Scan(&url, &secret)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	event := sampleWebhookEvent(req.Event)
+	body, err := json.Marshal(event)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := deliverWebhook(h.webhookClient, url, secret, event.Type, body)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// sampleWebhookEvent builds a test event with a made-up order; it never touches real orders.
+func sampleWebhookEvent(eventType string) WebhookEvent {
+	addr := "123 Sample Street"
+	pickup := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second).Format(time.RFC3339)
+	now := time.Now().UTC().Truncate(time.Second)
+	return WebhookEvent{
+		ID:        "evt_test_" + randomHex(8),
+		Type:      eventType,
+		Test:      true,
+		CreatedAt: now,
+		Data:      orderToResponse(0, 0, PrefDelivery, &addr, &pickup, now),
+	}
+}
+
+// newWebhookClient returns the client used for subscriber deliveries. Unless allowPrivate is set
+// (tests with local receivers only), connections to loopback, private, link-local and other
+// non-public addresses are refused. The check runs on the resolved address at dial time, so
+// DNS names pointing at internal hosts are caught too.
+// Redirects are reported as the receiver's answer instead of re-posting the signed body elsewhere.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookHTTPTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(ap.Addr()) {
+				return errWebhookDestination
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout:   webhookHTTPTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// cgnatPrefix is the carrier-grade NAT range (RFC 6598), which netip does not treat as private.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsGlobalUnicast() && !a.IsPrivate() && !cgnatPrefix.Contains(a)
+}
+
+// deliverWebhook POSTs a signed body to url with client and records the receiver's answer.
+func deliverWebhook(client *http.Client, url, secret, eventType string, body []byte) (out WebhookTestResponse) {
+	out = WebhookTestResponse{Event: eventType, URL: url}
+	start := time.Now()
+	defer func() { out.DurationMS = time.Since(start).Milliseconds() }()
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Signature", "t="+strconv.FormatInt(ts, 10)+",v1="+signWebhookPayload(secret, ts, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+	if err != nil {
+		out.Error = err.Error()
+	}
+	out.StatusCode = resp.StatusCode
+	out.Body = string(respBody)
+	return out
+}
+
+// signWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the subscriber's secret.
+// Receivers recompute it from the t= value in X-Webhook-Signature to verify the payload.
+func signWebhookPayload(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Deprecation describes a route, or a field in a route's response, that is scheduled for removal.
+// For fields, use a Route like "GET /orders/{id}#user_id" so the usage report tells them apart.
+type Deprecation struct {
+	Route  string
+	Since  time.Time // sent as the Deprecation header (RFC 9745); zero sends "true" when no date is known
+	Sunset time.Time // sent as the Sunset header (RFC 8594); zero if no removal date yet
+	Link   string    // migration notes, sent as Link rel="deprecation"; optional
+}
+
+// UsageRecorder stores which clients still call deprecated routes.
+type UsageRecorder interface {
+	RecordDeprecatedUsage(route, client string)
+}
+
+// Deprecated marks every response of a route as deprecated and records the caller.
+// Wrap it inside auth(...) so callers are identified by user id rather than IP.
+func Deprecated(d Deprecation, rec UsageRecorder) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			MarkDeprecated(w, r, d, rec)
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// MarkDeprecated sets the deprecation headers and records usage. Handlers call it directly
+// when they return a deprecated field; it must run before the response is written.
+func MarkDeprecated(w http.ResponseWriter, r *http.Request, d Deprecation, rec UsageRecorder) {
+	if d.Since.IsZero() {
+		// The pre-RFC 9745 draft form; "@-62135596800" would claim deprecation in year 1.
+		w.Header().Set("Deprecation", "true")
+	} else {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	}
+	if !d.Sunset.IsZero() {
+		w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		w.Header().Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+	}
+	if rec != nil {
+		rec.RecordDeprecatedUsage(d.Route, ClientID(r))
+	}
+}
+
+// ClientID identifies the caller for usage reports: "user:<id>" when authenticated, else "ip:<addr>".
+func ClientID(r *http.Request) string {
+	if id, ok := UserIDFrom(r.Context()); ok {
+		return "user:" + strconv.Itoa(id)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS webhook_subscriptions;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
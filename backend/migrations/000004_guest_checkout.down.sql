@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS account_claims;
+DELETE FROM users WHERE password_hash IS NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS is_guest;
+ALTER TABLE users ALTER COLUMN password_hash SET NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS deprecated_route_usage;
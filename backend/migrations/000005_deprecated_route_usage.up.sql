@@ -0,0 +1,8 @@
+CREATE TABLE deprecated_route_usage (
+    route VARCHAR(255) NOT NULL,
+    client VARCHAR(255) NOT NULL,
+    calls BIGINT NOT NULL DEFAULT 1,
+    first_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (route, client)
+);
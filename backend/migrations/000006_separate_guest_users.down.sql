@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_lower_email;
+DELETE FROM users g WHERE g.is_guest AND EXISTS (SELECT 1 FROM users a WHERE a.email = g.email AND NOT a.is_guest);
+DROP INDEX IF EXISTS users_email_guest_key;
+DROP INDEX IF EXISTS users_email_account_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
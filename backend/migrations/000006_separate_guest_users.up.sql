@@ -0,0 +1,7 @@
+-- Guest checkout never touches full accounts: an order placed with an account's email goes on a
+-- separate guest user. Email is therefore unique among accounts and among guests, not globally.
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+CREATE UNIQUE INDEX users_email_account_key ON users(email) WHERE NOT is_guest;
+CREATE UNIQUE INDEX users_email_guest_key ON users(email) WHERE is_guest;
+-- Guest checkout matches accounts case-insensitively.
+CREATE INDEX idx_users_lower_email ON users(lower(email));
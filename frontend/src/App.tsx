@@ -1,6 +1,7 @@
 import { Navigate, Route, Routes } from 'react-router-dom'
 import { useAuth } from './context/AuthContext'
 import Layout from './components/Layout'
+import Claim from './pages/Claim'
 import Login from './pages/Login'
 import Preference from './pages/Preference'
 
@@ -24,6 +25,7 @@ export default function App() {
         <Route index element={<ProtectedRoute><Preference /></ProtectedRoute>} />
         <Route path="summary" element={<Navigate to="/" replace />} />
         <Route path="login" element={<Login />} />
+        <Route path="claim" element={<Claim />} />
         <Route path="*" element={<Navigate to="/" replace />} />
       </Route>
     </Routes>
@@ -15,6 +15,18 @@ export async function login(email: string, password: string): Promise<{ token: s
   return data as { token: string }
 }
 
+/** Claim a guest account from the emailed magic link; returns a normal login token. */
+export async function claimAccount(token: string, password: string): Promise<{ token: string }> {
+  const res = await fetch(`${BASE}/auth/claim`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ token, password }),
+  })
+  const data = await res.json().catch(() => ({}))
+  if (!res.ok) throw new Error((data as { error?: string }).error || 'Claim failed')
+  return data as { token: string }
+}
+
 export async function me(): Promise<{ id: number; email: string }> {
   const token = getToken()
   if (!token) throw new Error('Not authenticated')
@@ -0,0 +1,56 @@
+import { render, screen, waitFor } from "@testing-library/react";
+import userEvent from "@testing-library/user-event";
+import { describe, it, expect, vi, beforeEach } from "vitest";
+import { MemoryRouter } from "react-router-dom";
+import Claim from "./Claim";
+import { AuthProvider } from "../context/AuthContext";
+import * as api from "../api/client";
+
+vi.mock("../api/client", () => ({ claimAccount: vi.fn(), me: vi.fn() }));
+
+function renderClaim(initialEntries = ["/claim?token=abc"]) {
+  return render(
+    <MemoryRouter initialEntries={initialEntries}>
+      <AuthProvider>
+        <Claim />
+      </AuthProvider>
+    </MemoryRouter>
+  );
+}
+
+describe("Claim", () => {
+  beforeEach(() => {
+    localStorage.clear();
+    vi.mocked(api.claimAccount).mockResolvedValue({ token: "full-token" });
+    vi.mocked(api.me).mockResolvedValue({ id: 1, email: "guest@example.com" });
+  });
+
+  it("shows an error when the link has no token", () => {
+    renderClaim(["/claim"]);
+    expect(screen.getByText(/this link is invalid/i)).toBeInTheDocument();
+  });
+
+  it("posts the link token with the new password and stores the login token", async () => {
+    const user = userEvent.setup();
+    renderClaim();
+    await user.type(screen.getByLabelText(/^password$/i), "new-password");
+    await user.type(screen.getByLabelText(/confirm password/i), "new-password");
+    await user.click(screen.getByRole("button", { name: /create account/i }));
+    await waitFor(() =>
+      expect(api.claimAccount).toHaveBeenCalledWith("abc", "new-password")
+    );
+    expect(localStorage.getItem("token")).toBe("full-token");
+  });
+
+  it("rejects mismatched passwords", async () => {
+    const user = userEvent.setup();
+    renderClaim();
+    await user.type(screen.getByLabelText(/^password$/i), "new-password");
+    await user.type(screen.getByLabelText(/confirm password/i), "other-password");
+    await user.click(screen.getByRole("button", { name: /create account/i }));
+    await waitFor(() =>
+      expect(screen.getByText(/passwords do not match/i)).toBeInTheDocument()
+    );
+    expect(api.claimAccount).not.toHaveBeenCalled();
+  });
+});
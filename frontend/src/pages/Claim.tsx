@@ -0,0 +1,106 @@
+import { useState } from "react";
+import { useForm } from "react-hook-form";
+import { useNavigate, useSearchParams } from "react-router-dom";
+import { z } from "zod";
+import { zodResolver } from "@hookform/resolvers/zod";
+import { claimAccount } from "../api/client";
+import { useAuth } from "../context/AuthContext";
+
+const schema = z
+  .object({
+    password: z.string().min(8, "Password must be at least 8 characters"),
+    confirm: z.string().min(1, "Please confirm your password"),
+  })
+  .refine((d) => d.password === d.confirm, {
+    message: "Passwords do not match",
+    path: ["confirm"],
+  });
+
+type FormData = z.infer<typeof schema>;
+
+/** Landing page for the guest checkout magic link: set a password to turn the guest into a full account. */
+export default function Claim() {
+  const { setToken } = useAuth();
+  const navigate = useNavigate();
+  const [params] = useSearchParams();
+  const claimToken = params.get("token") ?? "";
+  const [submitError, setSubmitError] = useState("");
+
+  const {
+    register,
+    handleSubmit,
+    formState: { errors, isSubmitting },
+  } = useForm<FormData>({
+    resolver: zodResolver(schema),
+  });
+
+  async function onSubmit(data: FormData) {
+    setSubmitError("");
+    try {
+      const { token } = await claimAccount(claimToken, data.password);
+      setToken(token);
+      navigate("/", { replace: true });
+    } catch (e) {
+      setSubmitError(e instanceof Error ? e.message : "Claim failed");
+    }
+  }
+
+  return (
+    <div className="page page--login">
+      <div className="login-card-wrapper">
+        <img src="/favicon.svg" alt="" className="login-logo" aria-hidden />
+        <p className="page--login-subtitle">
+          Set a password to manage your orders any time.
+        </p>
+        <div className="card login-card">
+          {!claimToken ? (
+            <p className="error">This link is invalid. Please use the link from your email.</p>
+          ) : (
+            <form onSubmit={handleSubmit(onSubmit)} className="login-form">
+              <div className="form-group">
+                <label htmlFor="password" className="label">
+                  Password
+                </label>
+                <input
+                  id="password"
+                  type="password"
+                  className="input"
+                  placeholder="••••••••"
+                  autoComplete="new-password"
+                  {...register("password")}
+                />
+                {errors.password && (
+                  <p className="error">{errors.password.message}</p>
+                )}
+              </div>
+              <div className="form-group">
+                <label htmlFor="confirm" className="label">
+                  Confirm password
+                </label>
+                <input
+                  id="confirm"
+                  type="password"
+                  className="input"
+                  placeholder="••••••••"
+                  autoComplete="new-password"
+                  {...register("confirm")}
+                />
+                {errors.confirm && (
+                  <p className="error">{errors.confirm.message}</p>
+                )}
+              </div>
+              {submitError && <p className="error">{submitError}</p>}
+              <button
+                type="submit"
+                disabled={isSubmitting}
+                className="btn btn-primary login-submit"
+              >
+                {isSubmitting ? "Saving…" : "Create account"}
+              </button>
+            </form>
+          )}
+        </div>
+      </div>
+    </div>
+  );
+}